@@ -0,0 +1,158 @@
+// Copyright 2020 Jared Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package proxier
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// APIServer exposes the worker's Create/Delete/List/Status operations,
+// plus a streaming Watch endpoint, over plain HTTP+JSON. This lets
+// editors, IDE plugins, and CI tools drive localizer without forking the
+// process, and lets a long-running daemon serve multiple clients.
+type APIServer struct {
+	w   *worker
+	srv *http.Server
+}
+
+// NewAPIServer creates an APIServer bound to addr. It doesn't start
+// listening until Start is called.
+func NewAPIServer(w *worker, addr string) *APIServer {
+	a := &APIServer{w: w}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/port-forwards", a.handlePortForwards)
+	mux.HandleFunc("/v1/port-forwards/watch", a.handleWatch)
+
+	a.srv = &http.Server{Addr: addr, Handler: mux}
+
+	return a
+}
+
+// Start runs the API server until ctx is canceled.
+func (a *APIServer) Start(ctx context.Context) error {
+	go func() {
+		<-ctx.Done()
+		a.srv.Close() //nolint:errcheck // best effort, we're shutting down
+	}()
+
+	if err := a.srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return errors.Wrap(err, "api server stopped unexpectedly")
+	}
+
+	return nil
+}
+
+// handlePortForwards dispatches Create (POST), Delete (DELETE), and
+// List/Status (GET) by HTTP method, since they all share the same
+// collection-shaped route.
+func (a *APIServer) handlePortForwards(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		a.handleCreate(w, r)
+	case http.MethodDelete:
+		a.handleDelete(w, r)
+	case http.MethodGet:
+		a.handleList(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (a *APIServer) handleCreate(w http.ResponseWriter, r *http.Request) {
+	var req CreatePortForwardRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := a.w.CreatePortForward(r.Context(), &req); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (a *APIServer) handleDelete(w http.ResponseWriter, r *http.Request) {
+	var req DeletePortForwardRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := a.w.DeletePortForward(r.Context(), &req); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleList returns every tracked connection. A ?service=name/namespace query
+// param narrows it down to a single connection's status.
+func (a *APIServer) handleList(w http.ResponseWriter, r *http.Request) {
+	if key := r.URL.Query().Get("service"); key != "" {
+		pf, ok := a.w.getPortForward(key)
+		if !ok {
+			http.Error(w, "no port-forward exists for this service", http.StatusNotFound)
+			return
+		}
+
+		writeJSON(w, pf)
+		return
+	}
+
+	writeJSON(w, a.w.listPortForwards())
+}
+
+// handleWatch streams newline-delimited JSON StatusEvents as they
+// happen, until the client disconnects.
+func (a *APIServer) handleWatch(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	events, unsubscribe := a.w.status.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(w)
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev := <-events:
+			if err := enc.Encode(ev); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
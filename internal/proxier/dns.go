@@ -0,0 +1,343 @@
+// Copyright 2020 Jared Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package proxier
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/txn2/txeh"
+)
+
+// DNSMode selects how localizer publishes hostnames for allocated IPs.
+type DNSMode string
+
+const (
+	// DNSModeHosts rewrites /etc/hosts, as localizer has always done.
+	// It's kept as a fallback for platforms or setups where binding
+	// port 53 isn't practical.
+	DNSModeHosts DNSMode = "hosts"
+
+	// DNSModeEmbedded runs an in-process DNS server that answers for the
+	// full set of kube service DNS names, instead of editing /etc/hosts.
+	DNSModeEmbedded DNSMode = "embedded"
+)
+
+// DNSConfig configures how the worker publishes hostnames.
+type DNSConfig struct {
+	Mode DNSMode
+
+	// Addr is the address the embedded DNS server listens on, e.g.
+	// "127.0.0.1:53". Only used when Mode is DNSModeEmbedded.
+	Addr string
+
+	// Zone is the cluster DNS zone suffix, e.g. "cluster.local". Only
+	// used when Mode is DNSModeEmbedded, where it's appended to produce
+	// each registered hostname's fully-qualified "svc.ns.svc.<zone>"
+	// form. Defaults to "cluster.local" when empty.
+	Zone string
+}
+
+// DNSResolver is the interface the worker uses to publish and retract
+// hostnames for allocated loopback IPs. It's implemented by both the
+// legacy /etc/hosts rewriter and the embedded DNS server, so the rest of
+// the worker doesn't need to care which is in use.
+type DNSResolver interface {
+	// AddHosts associates ip with the given hostnames.
+	AddHosts(ip string, hostnames []string)
+
+	// RemoveHosts removes any association for the given hostnames.
+	RemoveHosts(hostnames []string)
+
+	// Save persists or publishes pending changes.
+	Save() error
+
+	// Close releases any resources held by the resolver, e.g. listening
+	// sockets.
+	Close() error
+}
+
+// newDNSResolver builds the DNSResolver for cfg.
+func newDNSResolver(cfg DNSConfig, log logrus.FieldLogger) (DNSResolver, error) {
+	switch cfg.Mode {
+	case DNSModeEmbedded:
+		return newEmbeddedDNSResolver(cfg, log)
+	case DNSModeHosts, "":
+		path := defaultHostsFilePath()
+		hosts, err := txeh.NewHosts(&txeh.HostsConfig{ReadFilePath: path, WriteFilePath: path})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to open up hosts file for r/w")
+		}
+		return &hostsResolver{Hosts: hosts, path: path}, nil
+	default:
+		return nil, errors.Errorf("unknown dns mode %q", cfg.Mode)
+	}
+}
+
+// defaultHostsFilePath returns the OS-conventional hosts file location.
+// We pin it explicitly (instead of letting txeh guess) so that
+// hostsResolver.CleanStale can read the same file directly.
+func defaultHostsFilePath() string {
+	if runtime.GOOS == "windows" {
+		return `C:\Windows\System32\drivers\etc\hosts`
+	}
+
+	return "/etc/hosts"
+}
+
+// hostsSentinelHost is registered as an extra alias alongside every real
+// hostname localizer adds to /etc/hosts. It marks a line as
+// localizer-owned independently of state.json, so stale entries can
+// still be found and removed even if the state file itself was lost or
+// corrupted in whatever crash left them behind.
+const hostsSentinelHost = "localizer-managed.invalid"
+
+// hostsResolver adapts *txeh.Hosts to DNSResolver.
+type hostsResolver struct {
+	*txeh.Hosts
+	path string
+}
+
+// AddHosts registers hostnames for ip, tagging the line with
+// hostsSentinelHost.
+func (h *hostsResolver) AddHosts(ip string, hostnames []string) {
+	h.Hosts.AddHosts(ip, append(hostnames, hostsSentinelHost))
+}
+
+// RemoveHosts removes hostnames along with the sentinel tag, so a
+// legitimate teardown leaves no trace behind for CleanStale to trip
+// over later.
+func (h *hostsResolver) RemoveHosts(hostnames []string) {
+	h.Hosts.RemoveHosts(append(hostnames, hostsSentinelHost))
+}
+
+// Close is a no-op, /etc/hosts doesn't hold any resources open.
+func (h *hostsResolver) Close() error {
+	return nil
+}
+
+// CleanStale removes every /etc/hosts line tagged with hostsSentinelHost,
+// regardless of whether state.json still lists it. It's run once at
+// startup as a fallback for reconcileState's state.json-driven cleanup,
+// covering the case where the crash that left the hosts entries behind
+// also corrupted or lost the state file.
+func (h *hostsResolver) CleanStale() error {
+	b, err := ioutil.ReadFile(h.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var stale []string
+	for _, line := range strings.Split(string(b), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		tagged := false
+		for _, f := range fields[1:] {
+			if f == hostsSentinelHost {
+				tagged = true
+				break
+			}
+		}
+		if !tagged {
+			continue
+		}
+
+		stale = append(stale, fields[1:]...)
+	}
+
+	if len(stale) == 0 {
+		return nil
+	}
+
+	h.RemoveHosts(stale)
+
+	return h.Save()
+}
+
+// defaultDNSZone is used when DNSConfig.Zone is empty, matching the
+// cluster DNS zone most kubeadm/kubelet setups ship with.
+const defaultDNSZone = "cluster.local"
+
+// embeddedDNSResolver answers A/AAAA queries for the full set of kube
+// service DNS names (svc, svc.ns, svc.ns.svc, svc.ns.svc.cluster.local,
+// plus whatever headless-service per-pod names are registered by the
+// caller) directly, instead of rewriting /etc/hosts.
+type embeddedDNSResolver struct {
+	log  logrus.FieldLogger
+	zone string
+
+	mu      sync.RWMutex
+	records map[string]net.IP
+
+	pc     net.PacketConn
+	server *dns.Server
+}
+
+func newEmbeddedDNSResolver(cfg DNSConfig, log logrus.FieldLogger) (*embeddedDNSResolver, error) {
+	pc, err := net.ListenPacket("udp", cfg.Addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to bind embedded dns server on %s", cfg.Addr)
+	}
+
+	zone := cfg.Zone
+	if zone == "" {
+		zone = defaultDNSZone
+	}
+
+	e := &embeddedDNSResolver{
+		log:     log,
+		zone:    zone,
+		records: make(map[string]net.IP),
+		pc:      pc,
+	}
+
+	mux := dns.NewServeMux()
+	mux.HandleFunc(".", e.handleQuery)
+	e.server = &dns.Server{PacketConn: pc, Handler: mux}
+
+	go func() {
+		if err := e.server.ActivateAndServe(); err != nil {
+			e.log.WithError(err).Warn("embedded dns server stopped")
+		}
+	}()
+
+	return e, nil
+}
+
+// kubeServiceDNSNames expands a "svc.namespace" hostname into the full
+// set of names kube-dns/coredns would answer for that service: the bare
+// "svc" namespace-relative form (normally only resolvable from within
+// the same namespace, but there's only one local machine here, not one
+// per namespace), the "svc.namespace" two-label form, its
+// "svc.namespace.svc" SRV-style form, and the fully-qualified
+// "svc.namespace.svc.<zone>" form. Names that don't look like
+// "svc.namespace" (e.g. already fully-qualified headless-service
+// per-pod names) are returned unexpanded.
+func kubeServiceDNSNames(host, zone string) []string {
+	parts := strings.Split(host, ".")
+	if len(parts) != 2 {
+		return []string{host}
+	}
+
+	svc, ns := parts[0], parts[1]
+	names := []string{
+		svc,
+		host,
+		fmt.Sprintf("%s.%s.svc", svc, ns),
+	}
+
+	if zone != "" {
+		names = append(names, fmt.Sprintf("%s.%s.svc.%s", svc, ns, zone))
+	}
+
+	return names
+}
+
+// AddHosts registers every kube-style variant of each hostname (see
+// kubeServiceDNSNames) for ip.
+func (e *embeddedDNSResolver) AddHosts(ip string, hostnames []string) {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		e.log.WithField("ip", ip).Warn("embedded dns: invalid ip, skipping registration")
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, h := range hostnames {
+		for _, name := range kubeServiceDNSNames(h, e.zone) {
+			e.records[dns.Fqdn(strings.ToLower(name))] = parsed
+		}
+	}
+}
+
+// RemoveHosts unregisters every kube-style variant of the given hostnames.
+func (e *embeddedDNSResolver) RemoveHosts(hostnames []string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, h := range hostnames {
+		for _, name := range kubeServiceDNSNames(h, e.zone) {
+			delete(e.records, dns.Fqdn(strings.ToLower(name)))
+		}
+	}
+}
+
+// Save is a no-op: query answers are served straight from the in-memory
+// record set, there's nothing to flush to disk.
+func (e *embeddedDNSResolver) Save() error {
+	return nil
+}
+
+// Close shuts down the DNS server.
+func (e *embeddedDNSResolver) Close() error {
+	return e.server.Shutdown()
+}
+
+// handleQuery answers A/AAAA questions from the in-memory record set,
+// and NXDOMAINs everything else.
+func (e *embeddedDNSResolver) handleQuery(w dns.ResponseWriter, r *dns.Msg) {
+	reply := new(dns.Msg)
+	reply.SetReply(r)
+	reply.Authoritative = true
+
+	for _, q := range r.Question {
+		e.mu.RLock()
+		ip, ok := e.records[strings.ToLower(q.Name)]
+		e.mu.RUnlock()
+
+		if !ok {
+			continue
+		}
+
+		switch q.Qtype {
+		case dns.TypeA:
+			if v4 := ip.To4(); v4 != nil {
+				reply.Answer = append(reply.Answer, &dns.A{
+					Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 5},
+					A:   v4,
+				})
+			}
+		case dns.TypeAAAA:
+			if v4 := ip.To4(); v4 == nil {
+				reply.Answer = append(reply.Answer, &dns.AAAA{
+					Hdr:  dns.RR_Header{Name: q.Name, Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: 5},
+					AAAA: ip,
+				})
+			}
+		}
+	}
+
+	if len(reply.Answer) == 0 {
+		reply.Rcode = dns.RcodeNameError
+	}
+
+	if err := w.WriteMsg(reply); err != nil {
+		e.log.WithError(err).Warn("embedded dns: failed to write response")
+	}
+}
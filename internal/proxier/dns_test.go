@@ -0,0 +1,137 @@
+// Copyright 2020 Jared Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package proxier
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/sirupsen/logrus"
+)
+
+func TestKubeServiceDNSNames(t *testing.T) {
+	cases := []struct {
+		name string
+		host string
+		zone string
+		want []string
+	}{
+		{
+			name: "expands a svc.namespace name",
+			host: "myapp.default",
+			zone: "cluster.local",
+			want: []string{"myapp", "myapp.default", "myapp.default.svc", "myapp.default.svc.cluster.local"},
+		},
+		{
+			name: "omits the zone form when zone is empty",
+			host: "myapp.default",
+			zone: "",
+			want: []string{"myapp", "myapp.default", "myapp.default.svc"},
+		},
+		{
+			name: "passes through names that aren't svc.namespace shaped",
+			host: "myapp-0.myapp.default.svc.cluster.local",
+			zone: "cluster.local",
+			want: []string{"myapp-0.myapp.default.svc.cluster.local"},
+		},
+	}
+
+	for _, c := range cases {
+		got := kubeServiceDNSNames(c.host, c.zone)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: kubeServiceDNSNames(%q, %q) = %v, want %v", c.name, c.host, c.zone, got, c.want)
+		}
+	}
+}
+
+// newTestEmbeddedDNSResolver builds an embeddedDNSResolver without
+// binding a real socket, so AddHosts/RemoveHosts/handleQuery can be
+// exercised directly.
+func newTestEmbeddedDNSResolver(zone string) *embeddedDNSResolver {
+	return &embeddedDNSResolver{
+		log:     logrus.New(),
+		zone:    zone,
+		records: make(map[string]net.IP),
+	}
+}
+
+func TestEmbeddedDNSResolverAddRemoveHosts(t *testing.T) {
+	e := newTestEmbeddedDNSResolver("cluster.local")
+
+	e.AddHosts("127.0.0.2", []string{"myapp.default"})
+
+	for _, name := range []string{"myapp.", "myapp.default.", "myapp.default.svc.", "myapp.default.svc.cluster.local."} {
+		if _, ok := e.records[name]; !ok {
+			t.Errorf("expected record for %q after AddHosts", name)
+		}
+	}
+
+	e.RemoveHosts([]string{"myapp.default"})
+
+	if len(e.records) != 0 {
+		t.Errorf("expected no records after RemoveHosts, got %v", e.records)
+	}
+}
+
+// fakeResponseWriter captures the message written by handleQuery without
+// requiring a real network connection.
+type fakeResponseWriter struct {
+	dns.ResponseWriter
+	written *dns.Msg
+}
+
+func (f *fakeResponseWriter) WriteMsg(m *dns.Msg) error {
+	f.written = m
+	return nil
+}
+
+func TestEmbeddedDNSResolverHandleQuery(t *testing.T) {
+	e := newTestEmbeddedDNSResolver("cluster.local")
+	e.AddHosts("127.0.0.2", []string{"myapp.default"})
+
+	req := new(dns.Msg)
+	req.SetQuestion("myapp.default.svc.cluster.local.", dns.TypeA)
+
+	w := &fakeResponseWriter{}
+	e.handleQuery(w, req)
+
+	if w.written == nil || len(w.written.Answer) != 1 {
+		t.Fatalf("expected one answer, got %v", w.written)
+	}
+
+	a, ok := w.written.Answer[0].(*dns.A)
+	if !ok {
+		t.Fatalf("expected an A record, got %T", w.written.Answer[0])
+	}
+
+	if !a.A.Equal(net.ParseIP("127.0.0.2")) {
+		t.Errorf("A record = %v, want 127.0.0.2", a.A)
+	}
+}
+
+func TestEmbeddedDNSResolverHandleQueryNXDOMAIN(t *testing.T) {
+	e := newTestEmbeddedDNSResolver("cluster.local")
+
+	req := new(dns.Msg)
+	req.SetQuestion("unknown.default.svc.cluster.local.", dns.TypeA)
+
+	w := &fakeResponseWriter{}
+	e.handleQuery(w, req)
+
+	if w.written == nil || w.written.Rcode != dns.RcodeNameError {
+		t.Fatalf("expected NXDOMAIN, got %v", w.written)
+	}
+}
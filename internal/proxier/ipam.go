@@ -0,0 +1,160 @@
+// Copyright 2020 Jared Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package proxier
+
+import (
+	"net"
+
+	"github.com/metal-stack/go-ipam"
+	"github.com/pkg/errors"
+)
+
+// defaultIPv6CIDR is the loopback-adjacent ULA range synthesized for
+// IPv6 when IPAMConfig.EnableIPv6 is set but no IPv6 CIDR was given
+// explicitly. ::1/128 alone only has one address, which isn't enough to
+// allocate more than a single forward from.
+const defaultIPv6CIDR = "fd00:6c6c::/64"
+
+// IPAMConfig configures the loopback address pool(s) localizer allocates
+// forwarded service IPs from.
+type IPAMConfig struct {
+	// CIDRs is the list of loopback CIDRs to allocate from, tried in
+	// order until one has a free address. Defaults to ["127.0.0.1/8"]
+	// when empty.
+	CIDRs []string
+
+	// EnableIPv6 additionally allocates from "::1/128" and a synthesized
+	// ULA range, for dual-stack services. Ignored if CIDRs already
+	// contains an IPv6 CIDR.
+	EnableIPv6 bool
+}
+
+// cidrs returns the effective list of CIDRs to allocate from.
+func (c IPAMConfig) cidrs() []string {
+	cidrs := c.CIDRs
+	if len(cidrs) == 0 {
+		cidrs = []string{"127.0.0.1/8"}
+	}
+
+	if c.EnableIPv6 && !hasIPv6CIDR(cidrs) {
+		cidrs = append(cidrs, "::1/128", defaultIPv6CIDR)
+	}
+
+	return cidrs
+}
+
+func hasIPv6CIDR(cidrs []string) bool {
+	for _, c := range cidrs {
+		ip, _, err := net.ParseCIDR(c)
+		if err == nil && ip.To4() == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newIPAMPool creates the IP pool and, for any configured CIDR that
+// actually contains one of the well-known loopback addresses (127.0.0.1,
+// ::1), reserves it so it's never handed out. CIDRs like "127.5.0.0/16"
+// don't contain either address and are left alone.
+func newIPAMPool(cfg IPAMConfig) (ipam.Ipamer, []string, error) {
+	ipamInstance := ipam.New()
+	cidrs := cfg.cidrs()
+
+	for _, cidr := range cidrs {
+		prefix, err := ipamInstance.NewPrefix(cidr)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "failed to create ip pool for %s", cidr)
+		}
+
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "failed to parse %s", cidr)
+		}
+
+		reserved := "127.0.0.1"
+		if network.IP.To4() == nil {
+			reserved = "::1"
+		}
+
+		if !network.Contains(net.ParseIP(reserved)) {
+			continue
+		}
+
+		if _, err := ipamInstance.AcquireSpecificIP(prefix.Cidr, reserved); err != nil {
+			return nil, nil, errors.Wrapf(err, "failed to reserve %s in pool %s", reserved, cidr)
+		}
+	}
+
+	return ipamInstance, cidrs, nil
+}
+
+// acquireIP tries each configured CIDR in order until one yields a free
+// address.
+func acquireIP(pool ipam.Ipamer, cidrs []string) (*ipam.IP, error) {
+	var lastErr error
+	for _, cidr := range cidrs {
+		ip, err := pool.AcquireIP(cidr)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		return ip, nil
+	}
+
+	return nil, errors.Wrap(lastErr, "failed to allocate IP from any configured CIDR")
+}
+
+// acquireSpecificIP re-acquires ip from whichever configured CIDR
+// contains it. Used during --takeover, to re-establish tunnels on the
+// exact IPs a previous, now-dead worker had allocated.
+func acquireSpecificIP(pool ipam.Ipamer, cidrs []string, ip net.IP) (*ipam.IP, error) {
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil || !network.Contains(ip) {
+			continue
+		}
+
+		return pool.AcquireSpecificIP(cidr, ip.String())
+	}
+
+	return nil, errors.Errorf("no configured cidr contains %s", ip)
+}
+
+// releaseIP releases ip from whichever configured CIDR it was allocated
+// from.
+func releaseIP(pool ipam.Ipamer, cidrs []string, ip net.IP) error {
+	var lastErr error
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			continue
+		}
+
+		if !network.Contains(ip) {
+			continue
+		}
+
+		if err := pool.ReleaseIPFromPrefix(cidr, ip.String()); err != nil {
+			lastErr = err
+			continue
+		}
+
+		return nil
+	}
+
+	return lastErr
+}
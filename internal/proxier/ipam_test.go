@@ -0,0 +1,73 @@
+// Copyright 2020 Jared Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package proxier
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIPAMConfigCIDRs(t *testing.T) {
+	cases := []struct {
+		name string
+		cfg  IPAMConfig
+		want []string
+	}{
+		{
+			name: "defaults to IPv4 loopback",
+			cfg:  IPAMConfig{},
+			want: []string{"127.0.0.1/8"},
+		},
+		{
+			name: "uses explicit CIDRs as-is",
+			cfg:  IPAMConfig{CIDRs: []string{"10.0.0.0/8"}},
+			want: []string{"10.0.0.0/8"},
+		},
+		{
+			name: "synthesizes an IPv6 range when enabled and none given",
+			cfg:  IPAMConfig{EnableIPv6: true},
+			want: []string{"127.0.0.1/8", "::1/128", defaultIPv6CIDR},
+		},
+		{
+			name: "doesn't duplicate an already-present IPv6 CIDR",
+			cfg:  IPAMConfig{CIDRs: []string{"127.0.0.1/8", "fd00::/64"}, EnableIPv6: true},
+			want: []string{"127.0.0.1/8", "fd00::/64"},
+		},
+	}
+
+	for _, c := range cases {
+		if got := c.cfg.cidrs(); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: cidrs() = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestHasIPv6CIDR(t *testing.T) {
+	cases := []struct {
+		name  string
+		cidrs []string
+		want  bool
+	}{
+		{name: "empty", cidrs: nil, want: false},
+		{name: "ipv4 only", cidrs: []string{"127.0.0.1/8"}, want: false},
+		{name: "ipv6 present", cidrs: []string{"127.0.0.1/8", "::1/128"}, want: true},
+		{name: "invalid cidr ignored", cidrs: []string{"not-a-cidr"}, want: false},
+	}
+
+	for _, c := range cases {
+		if got := hasIPv6CIDR(c.cidrs); got != c.want {
+			t.Errorf("%s: hasIPv6CIDR(%v) = %v, want %v", c.name, c.cidrs, got, c.want)
+		}
+	}
+}
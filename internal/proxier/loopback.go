@@ -0,0 +1,43 @@
+// Copyright 2020 Jared Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package proxier
+
+import (
+	"net"
+	"os/exec"
+)
+
+// createLoopbackAlias aliases ip onto lo0, branching on address family:
+// IPv4 addresses use the regular "alias" form, IPv6 addresses need
+// "inet6 <addr> alias" - the address comes right after "inet6", not
+// after the "alias" keyword.
+func createLoopbackAlias(ip net.IP) error {
+	args := []string{"lo0", "alias", ip.String(), "up"}
+	if ip.To4() == nil {
+		args = []string{"lo0", "inet6", ip.String(), "alias"}
+	}
+
+	return exec.Command("ifconfig", args...).Run()
+}
+
+// removeLoopbackAlias undoes createLoopbackAlias. IPv6 aliases are
+// removed with "delete", not the IPv4-only "-alias" flag.
+func removeLoopbackAlias(ip net.IP) error {
+	args := []string{"lo0", "-alias", ip.String()}
+	if ip.To4() == nil {
+		args = []string{"lo0", "inet6", ip.String(), "delete"}
+	}
+
+	return exec.Command("ifconfig", args...).Run()
+}
@@ -0,0 +1,322 @@
+// Copyright 2020 Jared Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package proxier
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/transport/spdy"
+)
+
+// SPDY port-forward protocol header names, as defined by
+// k8s.io/client-go/tools/portforward. They aren't exported by that
+// package, so we mirror them here to speak the protocol directly
+// against multiple pods at once.
+const (
+	spdyPortHeader      = "port"
+	spdyPortDataHeader  = "requestID"
+	spdyStreamType      = "streamType"
+	spdyStreamTypeError = "error"
+	spdyStreamTypeData  = "data"
+)
+
+// poolMember is a single pod backing a load-balanced port-forward, with
+// an already-established SPDY connection ready to have streams opened
+// against it.
+type poolMember struct {
+	Pod  PodInfo
+	conn httpstream.Connection
+
+	// nextRequestID is a per-connection monotonic counter used to pair
+	// each proxied connection's error/data stream, mirroring how
+	// k8s.io/client-go/tools/portforward.PortForwarder numbers streams.
+	// It must be unique per SPDY connection, not per pod, since every
+	// concurrent local connection multiplexed to this member shares the
+	// same connection.
+	nextRequestID uint32
+}
+
+// endpointPool is a set of pods backing the same service, load-balanced
+// across via round-robin. Unlike a single-pod port-forward, losing one
+// member doesn't tear down the local listener - it's just removed from
+// rotation.
+type endpointPool struct {
+	mu      sync.Mutex
+	members []*poolMember
+	next    int
+
+	listeners []net.Listener
+}
+
+// nextMember returns the next member to dispatch a connection to,
+// round-robin, or false if the pool is currently empty.
+func (p *endpointPool) nextMember() (*poolMember, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.members) == 0 {
+		return nil, false
+	}
+
+	m := p.members[p.next%len(p.members)]
+	p.next++
+
+	return m, true
+}
+
+// set replaces the pool's members wholesale, closing any members that
+// are no longer present.
+func (p *endpointPool) set(members []*poolMember) {
+	p.mu.Lock()
+	old := p.members
+	p.members = members
+	p.next = 0
+	p.mu.Unlock()
+
+	for _, m := range old {
+		if !containsMember(members, m.Pod) {
+			m.conn.Close() //nolint:errcheck // best effort
+		}
+	}
+}
+
+func containsMember(members []*poolMember, pod PodInfo) bool {
+	for _, m := range members {
+		if m.Pod == pod {
+			return true
+		}
+	}
+
+	return false
+}
+
+// dialPoolMember opens a persistent SPDY connection to a pod, ready for
+// streams to be created against it on demand.
+func (w *worker) dialPoolMember(pod PodInfo) (*poolMember, error) {
+	transport, upgrader, err := spdy.RoundTripperFor(w.rest)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to upgrade connection")
+	}
+
+	url := w.k.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(pod.Namespace).
+		Name(pod.Name).
+		SubResource("portforward").URL()
+
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, "POST", url)
+
+	conn, _, err := dialer.Dial(portforwardProtocolV1Name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to dial pod %s", pod.Key())
+	}
+
+	return &poolMember{Pod: pod, conn: conn}, nil
+}
+
+// portforwardProtocolV1Name is the SPDY sub-protocol kubelet expects for
+// port-forward connections.
+const portforwardProtocolV1Name = "portforward.k8s.io"
+
+// buildPool resolves every ready endpoint for si into a dialed pool
+// member, skipping (and logging) any pod that fails to dial rather than
+// failing the whole pool.
+func (w *worker) buildPool(ctx context.Context, si *ServiceInfo) (*endpointPool, error) {
+	pods, err := w.getReadyPodsForService(ctx, si)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := &endpointPool{}
+	members := make([]*poolMember, 0, len(pods))
+	for _, pod := range pods {
+		member, err := w.dialPoolMember(pod)
+		if err != nil {
+			w.log.WithError(err).WithField("endpoint", pod.Key()).Warn("failed to add pod to pool, skipping")
+			continue
+		}
+
+		members = append(members, member)
+	}
+	pool.members = members
+
+	return pool, nil
+}
+
+// startPool listens on ip for each of ports and round-robins accepted
+// connections across pool's members via per-connection SPDY streams.
+func (w *worker) startPool(ctx context.Context, ip net.IP, ports []int, pool *endpointPool) error {
+	for _, port := range ports {
+		ln, err := net.Listen("tcp", net.JoinHostPort(ip.String(), strconv.Itoa(port)))
+		if err != nil {
+			return errors.Wrap(err, "failed to listen for pooled port-forward")
+		}
+
+		pool.listeners = append(pool.listeners, ln)
+		go w.acceptPoolConns(ctx, ln, port, pool)
+	}
+
+	return nil
+}
+
+func (w *worker) acceptPoolConns(ctx context.Context, ln net.Listener, port int, pool *endpointPool) {
+	go func() {
+		<-ctx.Done()
+		ln.Close() //nolint:errcheck // best effort, we're shutting down
+	}()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			select {
+			case <-ctx.Done():
+				return
+			default:
+				w.log.WithError(err).Warn("pool listener closed")
+				return
+			}
+		}
+
+		member, ok := pool.nextMember()
+		if !ok {
+			w.log.Warn("dropping connection, pool has no ready members")
+			conn.Close() //nolint:errcheck // best effort
+			continue
+		}
+
+		go proxyPoolConn(conn, member, port, w.log)
+	}
+}
+
+// proxyPoolConn opens a data (and error) SPDY stream against member for
+// port and pipes conn's bytes over it until either side closes.
+func proxyPoolConn(conn net.Conn, member *poolMember, port int, log logrus.FieldLogger) {
+	defer conn.Close() //nolint:errcheck // best effort
+
+	requestID := atomic.AddUint32(&member.nextRequestID, 1) - 1
+
+	headers := http.Header{}
+	headers.Set(spdyPortHeader, strconv.Itoa(port))
+	headers.Set(spdyPortDataHeader, strconv.Itoa(int(requestID)))
+
+	headers.Set(spdyStreamType, spdyStreamTypeError)
+	errorStream, err := member.conn.CreateStream(headers)
+	if err != nil {
+		log.WithError(err).Warnf("failed to create error stream to %s", member.Pod.Key())
+		return
+	}
+	errorStream.Close() //nolint:errcheck // we never write to it, we just need it established
+
+	headers.Set(spdyStreamType, spdyStreamTypeData)
+	dataStream, err := member.conn.CreateStream(headers)
+	if err != nil {
+		log.WithError(err).Warnf("failed to create data stream to %s", member.Pod.Key())
+		return
+	}
+	defer dataStream.Close() //nolint:errcheck // best effort
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(dataStream, conn) //nolint:errcheck // connection teardown, nothing to do with the error
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(conn, dataStream) //nolint:errcheck // connection teardown, nothing to do with the error
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+// getReadyPodsForService returns every pod backing si's ready endpoints.
+func (w *worker) getReadyPodsForService(ctx context.Context, si *ServiceInfo) ([]PodInfo, error) {
+	e, err := w.k.CoreV1().Endpoints(si.Namespace).Get(ctx, si.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return podsFromEndpoints(e), nil
+}
+
+// updatePool reconciles conn's pool membership against a fresh Endpoints
+// object, dialing newly-ready pods and dropping ones that are no longer
+// present, without touching the local listener.
+func (w *worker) updatePool(ctx context.Context, conn *PortForwardConnection, endpoints *corev1.Endpoints) {
+	wanted := podsFromEndpoints(endpoints)
+
+	members := make([]*poolMember, 0, len(wanted))
+	for _, pod := range wanted {
+		if existing := conn.pool.findMember(pod); existing != nil {
+			members = append(members, existing)
+			continue
+		}
+
+		member, err := w.dialPoolMember(pod)
+		if err != nil {
+			w.log.WithError(err).WithField("endpoint", pod.Key()).Warn("failed to add pod to pool, skipping")
+			continue
+		}
+
+		members = append(members, member)
+	}
+
+	conn.pool.set(members)
+
+	if len(members) == 0 {
+		w.setPortForwardConnectionStatus(ctx, conn.Service, PortForwardStatusWaiting, "No endpoints were found.")
+	} else {
+		w.setPortForwardConnectionStatus(ctx, conn.Service, PortForwardStatusRunning, "")
+	}
+}
+
+// findMember returns the existing member for pod, if any, so it can be
+// kept across a pool update instead of being re-dialed.
+func (p *endpointPool) findMember(pod PodInfo) *poolMember {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, m := range p.members {
+		if m.Pod == pod {
+			return m
+		}
+	}
+
+	return nil
+}
+
+// podsFromEndpoints extracts the ready pods backing an Endpoints object.
+func podsFromEndpoints(e *corev1.Endpoints) []PodInfo {
+	pods := make([]PodInfo, 0)
+	for _, subset := range e.Subsets {
+		for _, addr := range subset.Addresses {
+			if addr.TargetRef == nil || addr.TargetRef.Kind != "Pod" {
+				continue
+			}
+
+			pods = append(pods, PodInfo{Name: addr.TargetRef.Name, Namespace: addr.TargetRef.Namespace})
+		}
+	}
+
+	return pods
+}
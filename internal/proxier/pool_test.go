@@ -0,0 +1,84 @@
+// Copyright 2020 Jared Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package proxier
+
+import "testing"
+
+func TestEndpointPoolNextMemberRoundRobins(t *testing.T) {
+	a := &poolMember{Pod: PodInfo{Name: "a"}}
+	b := &poolMember{Pod: PodInfo{Name: "b"}}
+	pool := &endpointPool{members: []*poolMember{a, b}}
+
+	want := []*poolMember{a, b, a, b, a}
+	for i, w := range want {
+		got, ok := pool.nextMember()
+		if !ok {
+			t.Fatalf("nextMember() call %d: ok = false, want true", i)
+		}
+		if got != w {
+			t.Errorf("nextMember() call %d = %v, want %v", i, got.Pod, w.Pod)
+		}
+	}
+}
+
+func TestEndpointPoolNextMemberEmpty(t *testing.T) {
+	pool := &endpointPool{}
+	if _, ok := pool.nextMember(); ok {
+		t.Error("nextMember() on empty pool: ok = true, want false")
+	}
+}
+
+func TestEndpointPoolFindMember(t *testing.T) {
+	a := &poolMember{Pod: PodInfo{Name: "a", Namespace: "ns"}}
+	pool := &endpointPool{members: []*poolMember{a}}
+
+	if got := pool.findMember(PodInfo{Name: "a", Namespace: "ns"}); got != a {
+		t.Errorf("findMember(a) = %v, want %v", got, a)
+	}
+
+	if got := pool.findMember(PodInfo{Name: "missing"}); got != nil {
+		t.Errorf("findMember(missing) = %v, want nil", got)
+	}
+}
+
+func TestContainsMember(t *testing.T) {
+	members := []*poolMember{
+		{Pod: PodInfo{Name: "a"}},
+		{Pod: PodInfo{Name: "b"}},
+	}
+
+	if !containsMember(members, PodInfo{Name: "a"}) {
+		t.Error("containsMember(a) = false, want true")
+	}
+
+	if containsMember(members, PodInfo{Name: "c"}) {
+		t.Error("containsMember(c) = true, want false")
+	}
+}
+
+func TestEndpointPoolSetResetsRotation(t *testing.T) {
+	a := &poolMember{Pod: PodInfo{Name: "a"}}
+	b := &poolMember{Pod: PodInfo{Name: "b"}}
+	pool := &endpointPool{members: []*poolMember{a, b}, next: 7}
+
+	// Members are carried over (not evicted) across the set call, so
+	// this only exercises that the rotation index is reset to the
+	// start rather than continuing from its prior value.
+	pool.set([]*poolMember{a, b})
+
+	got, ok := pool.nextMember()
+	if !ok || got != a {
+		t.Errorf("nextMember() after set = %v, %v, want %v, true", got, ok, a)
+	}
+}
@@ -18,15 +18,14 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
-	"os/exec"
 	"runtime"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/metal-stack/go-ipam"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
-	"github.com/txn2/txeh"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
@@ -36,6 +35,7 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
 type worker struct {
@@ -43,42 +43,68 @@ type worker struct {
 	rest *rest.Config
 	log  logrus.FieldLogger
 
-	ippool ipam.Ipamer
-	ipCidr string
-	dns    *txeh.Hosts
+	ippool  ipam.Ipamer
+	ipCidrs []string
+	dns     DNSResolver
 
-	reqChan    chan PortForwardRequest
-	reaperChan chan *corev1.Endpoints
-	doneChan   chan<- struct{}
+	reqChan       chan PortForwardRequest
+	reaperChan    chan *corev1.Endpoints
+	podReaperChan chan podEvent
+	doneChan      chan<- struct{}
 
+	status *statusBroadcaster
+
+	// portForwardsMu guards portForwards, which is read and written from
+	// the Reaper, PodReaper, Start, and API server goroutines, in
+	// addition to Start's original handling of reqChan.
+	portForwardsMu sync.RWMutex
 	// portForwards are existing port-forwards
 	portForwards map[string]*PortForwardConnection
+
+	// statePath is where portForwards is snapshotted after every change,
+	// so it can be recovered by a future instance's reconcileState. Empty
+	// disables persistence entirely.
+	statePath string
 }
 
 // NewPortForwarder creates a new port-forward worker that handles
-// creating port-forwards and destroying port-forwards.
+// creating port-forwards and destroying port-forwards. dnsConfig
+// selects whether hostnames are published by rewriting /etc/hosts or by
+// an embedded DNS server; the zero value falls back to /etc/hosts.
+// ipamConfig selects which loopback CIDR(s) IPs are allocated from; the
+// zero value falls back to IPv4-only "127.0.0.1/8". stateConfig
+// controls where previous port-forwards are recovered from, and whether
+// they're taken over or torn down; the zero value persists to
+// "~/.localizer/state.json" and tears down leftover port-forwards.
 //nolint:gocritic,lll // We're OK not naming these.
-func NewPortForwarder(ctx context.Context, k kubernetes.Interface, r *rest.Config, log logrus.FieldLogger) (chan<- PortForwardRequest, <-chan struct{}, *worker, error) {
-	ipamInstance := ipam.New()
-	prefix, err := ipamInstance.NewPrefix("127.0.0.1/8")
+func NewPortForwarder(ctx context.Context, k kubernetes.Interface, r *rest.Config, log logrus.FieldLogger, dnsConfig DNSConfig, ipamConfig IPAMConfig, stateConfig StateConfig) (chan<- PortForwardRequest, <-chan struct{}, *worker, error) {
+	ipamInstance, ipCidrs, err := newIPAMPool(ipamConfig)
 	if err != nil {
 		return nil, nil, nil, errors.Wrap(err, "failed to create ip pool")
 	}
 
-	// ensure that 127.0.0.1 is never allocated
-	_, err = ipamInstance.AcquireSpecificIP(prefix.Cidr, "127.0.0.1")
+	resolver, err := newDNSResolver(dnsConfig, log)
 	if err != nil {
-		return nil, nil, nil, errors.Wrap(err, "failed to create ip pool")
+		return nil, nil, nil, errors.Wrap(err, "failed to set up dns resolver")
+	}
+
+	statePath := stateConfig.Path
+	if statePath == "" {
+		statePath, err = defaultStatePath()
+		if err != nil {
+			return nil, nil, nil, errors.Wrap(err, "failed to determine state path")
+		}
 	}
 
-	hosts, err := txeh.NewHosts(&txeh.HostsConfig{})
+	prevState, err := loadState(statePath)
 	if err != nil {
-		return nil, nil, nil, errors.Wrap(err, "failed to open up hosts file for r/w")
+		return nil, nil, nil, errors.Wrap(err, "failed to load previous state")
 	}
 
 	doneChan := make(chan struct{})
 	reqChan := make(chan PortForwardRequest, 1024)
 	reaperChan := make(chan *corev1.Endpoints, 1024)
+	podReaperChan := make(chan podEvent, 1024)
 
 	_, endpointInformer := cache.NewInformer(
 		cache.NewListWatchFromClient(k.CoreV1().RESTClient(), "endpoints", corev1.NamespaceAll, fields.Everything()),
@@ -91,22 +117,56 @@ func NewPortForwarder(ctx context.Context, k kubernetes.Interface, r *rest.Confi
 		},
 	)
 
+	// pods are watched separately from endpoints, since Pod/Deployment/
+	// StatefulSet/DaemonSet targets aren't backed by a Service and so
+	// never show up in the endpoints informer above
+	_, podInformer := cache.NewInformer(
+		cache.NewListWatchFromClient(k.CoreV1().RESTClient(), "pods", corev1.NamespaceAll, fields.Everything()),
+		&corev1.Pod{},
+		time.Second*60,
+		cache.ResourceEventHandlerFuncs{
+			UpdateFunc: func(_, obj interface{}) {
+				podReaperChan <- podEvent{Pod: obj.(*corev1.Pod)}
+			},
+			DeleteFunc: func(obj interface{}) {
+				if pod, ok := obj.(*corev1.Pod); ok {
+					podReaperChan <- podEvent{Pod: pod, Deleted: true}
+					return
+				}
+
+				// the pod was missed by our watch and the informer only
+				// has its last-known state as a tombstone
+				if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+					if pod, ok := tombstone.Obj.(*corev1.Pod); ok {
+						podReaperChan <- podEvent{Pod: pod, Deleted: true}
+					}
+				}
+			},
+		},
+	)
+
 	w := &worker{
-		k:            k,
-		rest:         r,
-		log:          log,
-		ippool:       ipamInstance,
-		ipCidr:       prefix.Cidr,
-		dns:          hosts,
-		reqChan:      reqChan,
-		reaperChan:   reaperChan,
-		doneChan:     doneChan,
-		portForwards: make(map[string]*PortForwardConnection),
+		k:             k,
+		rest:          r,
+		log:           log,
+		ippool:        ipamInstance,
+		ipCidrs:       ipCidrs,
+		dns:           resolver,
+		reqChan:       reqChan,
+		reaperChan:    reaperChan,
+		podReaperChan: podReaperChan,
+		doneChan:      doneChan,
+		status:        newStatusBroadcaster(),
+		portForwards:  make(map[string]*PortForwardConnection),
+		statePath:     statePath,
 	}
 
 	go endpointInformer.Run(ctx.Done())
+	go podInformer.Run(ctx.Done())
 	go w.Reaper(ctx)
+	go w.PodReaper(ctx)
 	go w.Start(ctx)
+	go w.reconcileState(ctx, stateConfig, prevState)
 
 	return reqChan, doneChan, w, nil
 }
@@ -120,11 +180,18 @@ func (w *worker) Reaper(ctx context.Context) {
 		case endpoints := <-w.reaperChan:
 			// check if we care about this endpoint by checking if it's
 			// part of our registered services
-			conns, ok := w.portForwards[(&ServiceInfo{endpoints.Name, endpoints.Namespace, ""}).Key()]
+			conns, ok := w.getPortForward((&ServiceInfo{endpoints.Name, endpoints.Namespace, ""}).Key())
 			if !ok {
 				continue
 			}
 
+			// load-balanced connections don't tear down on subset changes,
+			// they just add/remove pool members in place
+			if conns.LoadBalance {
+				w.updatePool(ctx, conns, endpoints)
+				continue
+			}
+
 			foundEndpoints := make(map[PodInfo]bool)
 			for _, subset := range endpoints.Subsets {
 				for _, addr := range subset.Addresses {
@@ -158,35 +225,142 @@ func (w *worker) Reaper(ctx context.Context) {
 				}
 			}
 
-			// refresh pods we didn't find
-			w.reqChan <- PortForwardRequest{
-				CreatePortForwardRequest: &CreatePortForwardRequest{
+			if conns.OnRecreate != nil && !conns.OnRecreate(conns.Service, reason) {
+				w.log.WithField("service", conns.Service.Key()).Info("recreate vetoed by consumer")
+				continue
+			}
+
+			// refresh pods we didn't find, backing off so that a service
+			// whose endpoints are flapping doesn't cause a tight recreate
+			// loop
+			w.scheduleRecreate(ctx, &CreatePortForwardRequest{
+				Service:        conns.Service,
+				Target:         conns.Target,
+				Hostnames:      conns.Hostnames,
+				Ports:          conns.Ports,
+				Recreate:       true,
+				RecreateReason: reason,
+				RetryPolicy:    conns.RetryPolicy,
+				OnError:        conns.OnError,
+				OnRecreate:     conns.OnRecreate,
+			}, conns.Attempts)
+		}
+	}
+}
+
+// PodReaper reaps dead connections for targets that aren't backed by a
+// Service (Pod, Deployment, StatefulSet, DaemonSet), based off of pod
+// add/update/delete events.
+func (w *worker) PodReaper(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev := <-w.podReaperChan:
+			pod := ev.Pod
+			for _, conns := range w.listPortForwards() {
+				key := conns.Service.Key()
+				switch conns.Target.Kind {
+				case TargetKindPod, TargetKindDeployment, TargetKindStatefulSet, TargetKindDaemonSet:
+				default:
+					continue
+				}
+
+				var reason string
+				switch {
+				case conns.Pod.Key() != "/":
+					if conns.Pod.Name != pod.Name || conns.Pod.Namespace != pod.Namespace {
+						continue
+					}
+
+					// a delete event's pod object is the last-known state
+					// before removal and frequently still reports Ready:
+					// True (e.g. force-delete, node loss), so it must
+					// trigger recreation unconditionally; isPodReady only
+					// gates the still-exists update case.
+					if !ev.Deleted && isPodReady(pod) {
+						continue
+					}
+
+					reason = fmt.Sprintf("pod '%s' is no longer ready", conns.Pod.Key())
+					if ev.Deleted {
+						reason = fmt.Sprintf("pod '%s' was deleted", conns.Pod.Key())
+					}
+				case conns.Target.Kind == TargetKindPod || ev.Deleted || pod.Namespace != conns.Target.Namespace || !isPodReady(pod):
+					// handle a workload that had no ready pod at creation
+					// time (e.g. still rolling out), mirroring Reaper's
+					// analogous "service had no endpoints before" case.
+					// TargetKindPod always resolves conns.Pod up front, so
+					// it can't land here.
+					continue
+				default:
+					selector, err := w.selectorForWorkload(ctx, &conns.Target)
+					if err != nil || !selector.Matches(labels.Set(pod.Labels)) {
+						continue
+					}
+
+					reason = fmt.Sprintf("found a ready pod '%s', target originally had none", pod.Name)
+				}
+
+				if conns.OnRecreate != nil && !conns.OnRecreate(conns.Service, reason) {
+					w.log.WithField("service", key).Info("recreate vetoed by consumer")
+					continue
+				}
+
+				w.scheduleRecreate(ctx, &CreatePortForwardRequest{
 					Service:        conns.Service,
+					Target:         conns.Target,
 					Hostnames:      conns.Hostnames,
 					Ports:          conns.Ports,
 					Recreate:       true,
 					RecreateReason: reason,
-				},
+					RetryPolicy:    conns.RetryPolicy,
+					OnError:        conns.OnError,
+					OnRecreate:     conns.OnRecreate,
+				}, conns.Attempts)
 			}
 		}
 	}
 }
 
+// scheduleRecreate enqueues req on reqChan after backing off, so that
+// recreates triggered by the Reaper/PodReaper (endpoint/pod churn) don't
+// tight-loop the same way a crash-looping pod or flaky API server would
+// if retried immediately.
+func (w *worker) scheduleRecreate(ctx context.Context, req *CreatePortForwardRequest, attempts int) {
+	retryPolicy := req.RetryPolicy
+	if retryPolicy == nil {
+		retryPolicy = DefaultRetryPolicy()
+	}
+
+	delay := retryPolicy.delayForAttempt(attempts)
+	time.AfterFunc(delay, func() {
+		select {
+		case <-ctx.Done():
+		case w.reqChan <- PortForwardRequest{CreatePortForwardRequest: req}:
+		}
+	})
+}
+
 // Start starts the worker process. This is done when the worker is created
 // and should be run in a goroutine if this is created manually.
 func (w *worker) Start(ctx context.Context) {
 	for {
 		select {
 		case <-ctx.Done():
-			for info := range w.portForwards {
+			for _, conns := range w.listPortForwards() {
 				err := w.DeletePortForward(ctx, &DeletePortForwardRequest{
-					Service: w.portForwards[info].Service,
+					Service: conns.Service,
 				})
 				if err != nil {
 					w.log.WithError(err).Warn("failed to clean up port-forward")
 				}
 			}
 
+			if err := w.dns.Close(); err != nil {
+				w.log.WithError(err).Warn("failed to close dns resolver")
+			}
+
 			// close our channel(s)
 			close(w.doneChan)
 
@@ -247,6 +421,17 @@ loop:
 }
 
 func (w *worker) CreatePortForward(ctx context.Context, req *CreatePortForwardRequest) (returnedError error) {
+	// Service is also used as the map/DNS key for non-service targets, so
+	// that Pod/Deployment/StatefulSet/DaemonSet/URL forwards are tracked
+	// the same way Service ones always have been.
+	if req.Target.Kind != "" && req.Target.Kind != TargetKindService && req.Service == (ServiceInfo{}) {
+		name := req.Target.Name
+		if req.Target.Kind == TargetKindURL {
+			name = req.Target.HostPort
+		}
+		req.Service = ServiceInfo{Name: name, Namespace: req.Target.Namespace}
+	}
+
 	serviceKey := req.Service.Key()
 	log := w.log.WithField("service", serviceKey)
 	if req.Endpoint != nil {
@@ -255,23 +440,65 @@ func (w *worker) CreatePortForward(ctx context.Context, req *CreatePortForwardRe
 
 	// skip port-forwards that are already being managed
 	// unless it's marked as being recreated
-	if _, ok := w.portForwards[serviceKey]; ok && !req.Recreate {
+	existing, hasExisting := w.getPortForward(serviceKey)
+	if hasExisting && !req.Recreate {
 		return fmt.Errorf("already have a port-forward for this service")
 	}
 
+	retryPolicy := req.RetryPolicy
+	if retryPolicy == nil {
+		retryPolicy = DefaultRetryPolicy()
+	}
+
+	attempts := 1
 	if req.Recreate {
+		if hasExisting {
+			attempts = existing.Attempts + 1
+		}
+
+		if retryPolicy.exhausted(attempts) {
+			reason := fmt.Sprintf("giving up after %d attempts: %v", attempts-1, req.RecreateReason)
+			log.Warn(reason)
+			w.setPortForwardConnectionStatus(ctx, req.Service, PortForwardStatusFailed, reason)
+
+			// give up for good: release the IP, alias, and DNS/hosts
+			// entries the existing connection was holding, rather than
+			// leaking them until an explicit DeletePortForward. There
+			// may be nothing to release if the service was deleted (via
+			// DeletePortForward) while this recreate was backed off.
+			if hasExisting {
+				if err := w.stopPortForward(ctx, existing); err != nil {
+					log.WithError(err).Warn("failed to cleanup exhausted port-forward")
+				}
+				w.deletePortForward(serviceKey)
+			}
+
+			if req.OnError != nil {
+				req.OnError(req.Service, fmt.Errorf(reason))
+			}
+			return nil
+		}
+
 		log.Infof("recreating port-forward due to: %v", req.RecreateReason)
 		w.setPortForwardConnectionStatus(ctx, req.Service, PortForwardStatusRecreating, req.RecreateReason)
-		err := w.stopPortForward(ctx, w.portForwards[serviceKey])
-		if err != nil {
-			log.WithError(err).Warn("failed to cleanup previous port-forward")
+
+		// existing may be nil if the service was deleted (via
+		// DeletePortForward) while this recreate was backed off.
+		if hasExisting {
+			if err := w.stopPortForward(ctx, existing); err != nil {
+				log.WithError(err).Warn("failed to cleanup previous port-forward")
+			}
 		}
 	}
 
 	pf := &PortForwardConnection{
-		Service: req.Service,
-		Status:  PortForwardStatusRunning,
-		Ports:   req.Ports,
+		Service:     req.Service,
+		Status:      PortForwardStatusRunning,
+		Ports:       req.Ports,
+		Attempts:    attempts,
+		RetryPolicy: retryPolicy,
+		OnError:     req.OnError,
+		OnRecreate:  req.OnRecreate,
 	}
 
 	// cleanup after failed tunnel (that failed to be created)
@@ -291,17 +518,22 @@ func (w *worker) CreatePortForward(ctx context.Context, req *CreatePortForwardRe
 	}
 
 	// TODO: need to release on error
-	ipAddress, err := w.ippool.AcquireIP(w.ipCidr)
+	var ipAddress *ipam.IP
+	if req.PreferredIP != nil {
+		ipAddress, err = acquireSpecificIP(w.ippool, w.ipCidrs, req.PreferredIP)
+	} else {
+		ipAddress, err = acquireIP(w.ippool, w.ipCidrs)
+	}
 	if err != nil {
 		return errors.Wrap(err, "failed to allocate IP")
 	}
 	pf.IP = ipAddress.IP
 
 	// We only need to create alias on darwin, on other platforms
-	// lo0 becomes lo and routes the full /8
+	// lo0 becomes lo and routes the full /8 (and the IPv6 equivalent for
+	// ::1)
 	if runtime.GOOS == "darwin" {
-		args := []string{"lo0", "alias", ipAddress.IP.String(), "up"}
-		if err := exec.Command("ifconfig", args...).Run(); err != nil {
+		if err := createLoopbackAlias(ipAddress.IP); err != nil {
 			return errors.Wrap(err, "failed to create ip link")
 		}
 	}
@@ -312,19 +544,65 @@ func (w *worker) CreatePortForward(ctx context.Context, req *CreatePortForwardRe
 		return errors.Wrap(err, "failed to save DNS changes")
 	}
 
+	pf.Target = req.Target
+
+	// URL targets don't go through a pod at all, they're proxied straight
+	// to an external host:port
+	if req.Target.Kind == TargetKindURL {
+		listeners, err := w.startURLProxy(ctx, ipAddress.IP, req.Ports, req.Target.HostPort)
+		if err != nil {
+			return errors.Wrap(err, "failed to start url proxy")
+		}
+		pf.urlListeners = listeners
+
+		w.setPortForward(req.Service.Key(), pf)
+		w.status.publish(StatusEvent{Service: req.Service, Status: pf.Status, Reason: pf.StatusReason})
+		return nil
+	}
+
+	// load-balanced services forward to every ready endpoint, rather than
+	// a single pod, so a restarting pod only drops its share of the pool
+	// instead of the whole tunnel
+	if req.LoadBalance && (req.Target.Kind == "" || req.Target.Kind == TargetKindService) {
+		pool, err := w.buildPool(ctx, &req.Service)
+		if err != nil {
+			return errors.Wrap(err, "failed to build endpoint pool")
+		}
+
+		if err := w.startPool(ctx, ipAddress.IP, req.Ports, pool); err != nil {
+			return errors.Wrap(err, "failed to start endpoint pool")
+		}
+
+		pf.LoadBalance = true
+		pf.pool = pool
+		if len(pool.members) == 0 {
+			pf.Status = PortForwardStatusWaiting
+			pf.StatusReason = "No endpoints were found."
+		}
+
+		w.setPortForward(req.Service.Key(), pf)
+		w.status.publish(StatusEvent{Service: req.Service, Status: pf.Status, Reason: pf.StatusReason})
+		return nil
+	}
+
 	transport, upgrader, err := spdy.RoundTripperFor(w.rest)
 	if err != nil {
 		return errors.Wrap(err, "failed to upgrade connection")
 	}
 
 	var pod *PodInfo
-	if req.Endpoint == nil {
-		podInfo, err := w.getPodForService(ctx, &req.Service)
+	if req.Endpoint != nil {
+		pod = req.Endpoint
+	} else if req.Target.Kind != "" && req.Target.Kind != TargetKindService {
+		podInfo, err := w.resolveTarget(ctx, &req.Target)
 		if err == nil {
 			pod = &podInfo
 		}
 	} else {
-		pod = req.Endpoint
+		podInfo, err := w.getPodForService(ctx, &req.Service)
+		if err == nil {
+			pod = &podInfo
+		}
 	}
 
 	// only create the tunnel if we found a pod, if we didn't
@@ -356,16 +634,37 @@ func (w *worker) CreatePortForward(ctx context.Context, req *CreatePortForwardRe
 			default:
 			}
 
-			// otherwise, recreate it
-			w.reqChan <- PortForwardRequest{
-				CreatePortForwardRequest: &CreatePortForwardRequest{
-					Service:        req.Service,
-					Hostnames:      req.Hostnames,
-					Ports:          req.Ports,
-					Recreate:       true,
-					RecreateReason: fmt.Sprintf("%v", err),
-				},
+			if req.OnError != nil {
+				req.OnError(req.Service, err)
 			}
+
+			recreateReason := fmt.Sprintf("%v", err)
+
+			if req.OnRecreate != nil && !req.OnRecreate(req.Service, recreateReason) {
+				log.Info("recreate vetoed by consumer")
+				return
+			}
+
+			recreateReq := &CreatePortForwardRequest{
+				Service:        req.Service,
+				Hostnames:      req.Hostnames,
+				Ports:          req.Ports,
+				Recreate:       true,
+				RecreateReason: recreateReason,
+				RetryPolicy:    retryPolicy,
+				OnError:        req.OnError,
+				OnRecreate:     req.OnRecreate,
+			}
+
+			// back off before recreating, so that a crash-looping pod or a
+			// flaky API server doesn't cause a tight recreate loop
+			delay := retryPolicy.delayForAttempt(attempts)
+			time.AfterFunc(delay, func() {
+				select {
+				case <-ctx.Done():
+				case w.reqChan <- PortForwardRequest{CreatePortForwardRequest: recreateReq}:
+				}
+			})
 		}()
 	} else {
 		log.Warn("skipping tunnel creation due to no endpoint being found")
@@ -374,21 +673,24 @@ func (w *worker) CreatePortForward(ctx context.Context, req *CreatePortForwardRe
 	}
 
 	// mark that this is allocated
-	w.portForwards[req.Service.Key()] = pf
+	w.setPortForward(req.Service.Key(), pf)
+	w.status.publish(StatusEvent{Service: req.Service, Status: pf.Status, Reason: pf.StatusReason})
 
 	return nil
 }
 
 func (w *worker) setPortForwardConnectionStatus(_ context.Context, si ServiceInfo, status PortForwardStatus, reason string) {
 	key := si.Key()
-	pf, ok := w.portForwards[key]
+	pf, ok := w.getPortForward(key)
 	if !ok {
 		return
 	}
 
 	pf.Status = status
 	pf.StatusReason = reason
-	w.portForwards[key] = pf
+	w.setPortForward(key, pf)
+
+	w.status.publish(StatusEvent{Service: si, Status: status, Reason: reason})
 }
 
 func (w *worker) stopPortForward(_ context.Context, conn *PortForwardConnection) error {
@@ -396,8 +698,19 @@ func (w *worker) stopPortForward(_ context.Context, conn *PortForwardConnection)
 		conn.pf.Close()
 	}
 
+	for _, ln := range conn.urlListeners {
+		ln.Close() //nolint:errcheck // best effort
+	}
+
+	if conn.pool != nil {
+		for _, ln := range conn.pool.listeners {
+			ln.Close() //nolint:errcheck // best effort
+		}
+		conn.pool.set(nil)
+	}
+
 	errs := make([]error, 0)
-	err := w.ippool.ReleaseIPFromPrefix(w.ipCidr, conn.IP.String())
+	err := releaseIP(w.ippool, w.ipCidrs, conn.IP)
 	if err != nil {
 		errs = append(errs, errors.Wrap(err, "failed to release ip address"))
 	}
@@ -405,9 +718,7 @@ func (w *worker) stopPortForward(_ context.Context, conn *PortForwardConnection)
 	// If we are on a platform that needs aliases
 	// then we need to remove it
 	if runtime.GOOS == "darwin" {
-		ipStr := conn.IP.String()
-		args := []string{"lo0", "-alias", ipStr}
-		if err := exec.Command("ifconfig", args...).Run(); err != nil {
+		if err := removeLoopbackAlias(conn.IP); err != nil {
 			errs = append(errs, errors.Wrap(err, "failed to release ip alias"))
 		}
 	}
@@ -435,16 +746,17 @@ func (w *worker) DeletePortForward(ctx context.Context, req *DeletePortForwardRe
 	log := w.log.WithField("service", serviceKey)
 
 	// skip port-forwards that are already being managed
-	if w.portForwards[serviceKey] == nil {
+	conn, ok := w.getPortForward(serviceKey)
+	if !ok {
 		return fmt.Errorf("no port-forward exists for this service")
 	}
 
-	if err := w.stopPortForward(ctx, w.portForwards[serviceKey]); err != nil {
+	if err := w.stopPortForward(ctx, conn); err != nil {
 		log.WithError(err).Warn("failed to cleanup port-forward")
 	}
 
 	// now mark it as not being allocated
-	delete(w.portForwards, serviceKey)
+	w.deletePortForward(serviceKey)
 
 	log.Info("stopped port-forward")
 
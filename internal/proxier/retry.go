@@ -0,0 +1,71 @@
+// Copyright 2020 Jared Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package proxier
+
+import "time"
+
+// RetryPolicy controls how port-forward recreation is paced after a
+// failure, so that a crash-looping pod or a flaky API server doesn't
+// cause a tight recreate loop.
+type RetryPolicy struct {
+	// InitialDelay is how long to wait before the first recreate attempt.
+	InitialDelay time.Duration
+
+	// MaxDelay caps the delay between recreate attempts, regardless of
+	// how many attempts have been made.
+	MaxDelay time.Duration
+
+	// Factor is the exponential backoff multiplier applied after each
+	// failed attempt.
+	Factor float64
+
+	// MaxAttempts is the number of attempts allowed, counting the initial
+	// creation, before the port-forward is marked as failed and no longer
+	// retried. Zero means unlimited.
+	MaxAttempts int
+}
+
+// DefaultRetryPolicy returns the retry policy used when a
+// CreatePortForwardRequest doesn't specify one.
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		InitialDelay: time.Second,
+		MaxDelay:     time.Minute,
+		Factor:       2,
+		MaxAttempts:  0,
+	}
+}
+
+// delayForAttempt returns how long to wait before the given attempt
+// number (1-indexed) is made.
+func (r *RetryPolicy) delayForAttempt(attempt int) time.Duration {
+	if attempt <= 1 {
+		return r.InitialDelay
+	}
+
+	delay := float64(r.InitialDelay)
+	for i := 1; i < attempt; i++ {
+		delay *= r.Factor
+		if time.Duration(delay) >= r.MaxDelay {
+			return r.MaxDelay
+		}
+	}
+
+	return time.Duration(delay)
+}
+
+// exhausted returns true if attempt has used up the allowed retries.
+func (r *RetryPolicy) exhausted(attempt int) bool {
+	return r.MaxAttempts > 0 && attempt > r.MaxAttempts
+}
@@ -0,0 +1,66 @@
+// Copyright 2020 Jared Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package proxier
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDelayForAttempt(t *testing.T) {
+	r := &RetryPolicy{
+		InitialDelay: time.Second,
+		MaxDelay:     10 * time.Second,
+		Factor:       2,
+	}
+
+	cases := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{attempt: 0, want: time.Second},
+		{attempt: 1, want: time.Second},
+		{attempt: 2, want: 2 * time.Second},
+		{attempt: 3, want: 4 * time.Second},
+		{attempt: 4, want: 8 * time.Second},
+		{attempt: 5, want: 10 * time.Second}, // capped by MaxDelay
+		{attempt: 10, want: 10 * time.Second},
+	}
+
+	for _, c := range cases {
+		if got := r.delayForAttempt(c.attempt); got != c.want {
+			t.Errorf("delayForAttempt(%d) = %v, want %v", c.attempt, got, c.want)
+		}
+	}
+}
+
+func TestRetryPolicyExhausted(t *testing.T) {
+	cases := []struct {
+		name        string
+		maxAttempts int
+		attempt     int
+		want        bool
+	}{
+		{name: "unlimited", maxAttempts: 0, attempt: 1000, want: false},
+		{name: "within limit", maxAttempts: 3, attempt: 3, want: false},
+		{name: "over limit", maxAttempts: 3, attempt: 4, want: true},
+	}
+
+	for _, c := range cases {
+		r := &RetryPolicy{MaxAttempts: c.maxAttempts}
+		if got := r.exhausted(c.attempt); got != c.want {
+			t.Errorf("%s: exhausted(%d) = %v, want %v", c.name, c.attempt, got, c.want)
+		}
+	}
+}
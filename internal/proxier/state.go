@@ -0,0 +1,170 @@
+// Copyright 2020 Jared Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package proxier
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/pkg/errors"
+)
+
+// StateConfig configures how the worker persists and recovers its
+// port-forward assignments across restarts.
+type StateConfig struct {
+	// Path is where state is written. Defaults to
+	// "~/.localizer/state.json" when empty.
+	Path string
+
+	// Takeover, when set, re-establishes tunnels on the same IPs a
+	// previous worker had allocated instead of releasing them, so
+	// long-lived client connections to those IPs survive the handoff.
+	Takeover bool
+}
+
+// stateEntry is the persisted record of a single port-forward.
+type stateEntry struct {
+	Service   ServiceInfo `json:"service"`
+	Target    TargetRef   `json:"target"`
+	IP        net.IP      `json:"ip"`
+	Hostnames []string    `json:"hostnames"`
+	Ports     []int       `json:"ports"`
+}
+
+// state is the on-disk representation of every tracked port-forward.
+type state struct {
+	Entries []stateEntry `json:"entries"`
+}
+
+// defaultStatePath returns "~/.localizer/state.json".
+func defaultStatePath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to determine home directory")
+	}
+
+	return filepath.Join(home, ".localizer", "state.json"), nil
+}
+
+// loadState reads state from path, returning an empty state if the file
+// doesn't exist yet.
+func loadState(path string) (*state, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &state{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var s state
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// save writes s to path, creating its parent directory if needed.
+func (s *state) save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, b, 0o600)
+}
+
+// persistState snapshots the worker's current port-forwards to disk.
+// Errors are logged rather than returned, since a failed state write
+// shouldn't fail the port-forward operation that triggered it.
+func (w *worker) persistState() {
+	if w.statePath == "" {
+		return
+	}
+
+	s := &state{}
+	for _, pf := range w.listPortForwards() {
+		s.Entries = append(s.Entries, stateEntry{
+			Service:   pf.Service,
+			Target:    pf.Target,
+			IP:        pf.IP,
+			Hostnames: pf.Hostnames,
+			Ports:     pf.Ports,
+		})
+	}
+
+	if err := s.save(w.statePath); err != nil {
+		w.log.WithError(err).Warn("failed to persist port-forward state")
+	}
+}
+
+// reconcileState is run once at startup. For each entry left behind by
+// a previous, presumably crashed, worker: in --takeover mode it's
+// re-established on the same IP; otherwise its alias, hosts entries,
+// and IP reservation are released.
+func (w *worker) reconcileState(_ context.Context, cfg StateConfig, prev *state) {
+	// state.json only tells us about entries the previous worker managed
+	// to persist before it died. If the same crash corrupted or lost the
+	// state file, fall back to the sentinel tag in /etc/hosts itself,
+	// which doesn't depend on state.json surviving at all.
+	if hr, ok := w.dns.(*hostsResolver); ok {
+		if err := hr.CleanStale(); err != nil {
+			w.log.WithError(err).Warn("failed to clean stale localizer hosts entries")
+		}
+	}
+
+	for _, entry := range prev.Entries {
+		log := w.log.WithField("service", entry.Service.Key())
+
+		if cfg.Takeover {
+			log.Info("taking over port-forward from previous instance")
+			w.reqChan <- PortForwardRequest{
+				CreatePortForwardRequest: &CreatePortForwardRequest{
+					Service:     entry.Service,
+					Target:      entry.Target,
+					Hostnames:   entry.Hostnames,
+					Ports:       entry.Ports,
+					PreferredIP: entry.IP,
+				},
+			}
+			continue
+		}
+
+		log.Info("cleaning up stale port-forward from previous instance")
+
+		if runtime.GOOS == "darwin" {
+			if err := removeLoopbackAlias(entry.IP); err != nil {
+				log.WithError(err).Warn("failed to remove stale ip alias")
+			}
+		}
+
+		w.dns.RemoveHosts(entry.Hostnames)
+		if err := w.dns.Save(); err != nil {
+			log.WithError(err).Warn("failed to remove stale dns entries")
+		}
+
+		if err := releaseIP(w.ippool, w.ipCidrs, entry.IP); err != nil {
+			log.WithError(err).Warn("failed to release stale ip")
+		}
+	}
+}
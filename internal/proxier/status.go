@@ -0,0 +1,67 @@
+// Copyright 2020 Jared Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package proxier
+
+import "sync"
+
+// StatusEvent is emitted whenever a port-forward's status changes, so
+// that API consumers (e.g. a Watch stream) can react without polling.
+type StatusEvent struct {
+	Service ServiceInfo
+	Status  PortForwardStatus
+	Reason  string
+}
+
+// statusBroadcaster fans StatusEvents out to any number of subscribers,
+// e.g. API server Watch streams.
+type statusBroadcaster struct {
+	mu   sync.Mutex
+	subs map[chan StatusEvent]struct{}
+}
+
+func newStatusBroadcaster() *statusBroadcaster {
+	return &statusBroadcaster{subs: make(map[chan StatusEvent]struct{})}
+}
+
+// Subscribe returns a channel that receives every future StatusEvent.
+// The caller must call the returned func to unsubscribe once done, or
+// the channel will leak.
+func (b *statusBroadcaster) Subscribe() (<-chan StatusEvent, func()) {
+	ch := make(chan StatusEvent, 16)
+
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		delete(b.subs, ch)
+		b.mu.Unlock()
+		close(ch)
+	}
+}
+
+// publish sends ev to every current subscriber. Slow subscribers have
+// the event dropped rather than blocking the worker.
+func (b *statusBroadcaster) publish(ev StatusEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
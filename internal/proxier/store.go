@@ -0,0 +1,55 @@
+// Copyright 2020 Jared Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package proxier
+
+// getPortForward returns the tracked connection for key, if any.
+func (w *worker) getPortForward(key string) (*PortForwardConnection, bool) {
+	w.portForwardsMu.RLock()
+	defer w.portForwardsMu.RUnlock()
+
+	pf, ok := w.portForwards[key]
+	return pf, ok
+}
+
+// setPortForward tracks pf under key and persists the new state.
+func (w *worker) setPortForward(key string, pf *PortForwardConnection) {
+	w.portForwardsMu.Lock()
+	w.portForwards[key] = pf
+	w.portForwardsMu.Unlock()
+
+	w.persistState()
+}
+
+// deletePortForward stops tracking key and persists the new state.
+func (w *worker) deletePortForward(key string) {
+	w.portForwardsMu.Lock()
+	delete(w.portForwards, key)
+	w.portForwardsMu.Unlock()
+
+	w.persistState()
+}
+
+// listPortForwards returns a snapshot of every tracked connection,
+// safe to range over without holding the lock.
+func (w *worker) listPortForwards() []*PortForwardConnection {
+	w.portForwardsMu.RLock()
+	defer w.portForwardsMu.RUnlock()
+
+	out := make([]*PortForwardConnection, 0, len(w.portForwards))
+	for _, pf := range w.portForwards {
+		out = append(out, pf)
+	}
+
+	return out
+}
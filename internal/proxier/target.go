@@ -0,0 +1,107 @@
+// Copyright 2020 Jared Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package proxier
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// resolveTarget resolves a TargetRef down to the pod that traffic should
+// be forwarded to. TargetKindURL is not handled here, as it doesn't
+// forward through a pod at all; callers should branch on Kind before
+// calling this.
+func (w *worker) resolveTarget(ctx context.Context, target *TargetRef) (PodInfo, error) {
+	switch target.Kind {
+	case "", TargetKindService:
+		si := ServiceInfo{Name: target.Name, Namespace: target.Namespace}
+		return w.getPodForService(ctx, &si)
+	case TargetKindPod:
+		// skip the endpoints lookup entirely, the caller already knows
+		// exactly which pod they want
+		return PodInfo{Name: target.Name, Namespace: target.Namespace}, nil
+	case TargetKindDeployment, TargetKindStatefulSet, TargetKindDaemonSet:
+		selector, err := w.selectorForWorkload(ctx, target)
+		if err != nil {
+			return PodInfo{}, err
+		}
+
+		return w.getReadyPodForSelector(ctx, target.Namespace, selector)
+	default:
+		return PodInfo{}, fmt.Errorf("unsupported target kind %q", target.Kind)
+	}
+}
+
+// selectorForWorkload looks up the label selector for a workload-kind
+// TargetRef, so that its managed pods can be found.
+func (w *worker) selectorForWorkload(ctx context.Context, target *TargetRef) (labels.Selector, error) {
+	apps := w.k.AppsV1()
+
+	switch target.Kind {
+	case TargetKindDeployment:
+		d, err := apps.Deployments(target.Namespace).Get(ctx, target.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return metav1.LabelSelectorAsSelector(d.Spec.Selector)
+	case TargetKindStatefulSet:
+		s, err := apps.StatefulSets(target.Namespace).Get(ctx, target.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return metav1.LabelSelectorAsSelector(s.Spec.Selector)
+	case TargetKindDaemonSet:
+		d, err := apps.DaemonSets(target.Namespace).Get(ctx, target.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return metav1.LabelSelectorAsSelector(d.Spec.Selector)
+	default:
+		return nil, fmt.Errorf("%q is not a workload target kind", target.Kind)
+	}
+}
+
+// getReadyPodForSelector returns the first ready pod matching selector
+// in namespace.
+func (w *worker) getReadyPodForSelector(ctx context.Context, namespace string, selector labels.Selector) (PodInfo, error) {
+	pods, err := w.k.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: selector.String(),
+	})
+	if err != nil {
+		return PodInfo{}, err
+	}
+
+	for _, pod := range pods.Items {
+		if isPodReady(&pod) {
+			return PodInfo{Name: pod.Name, Namespace: pod.Namespace}, nil
+		}
+	}
+
+	return PodInfo{}, fmt.Errorf("failed to find a ready pod for selector %q", selector.String())
+}
+
+// isPodReady returns true if the pod's Ready condition is true.
+func isPodReady(pod *corev1.Pod) bool {
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,236 @@
+// Copyright 2020 Jared Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package proxier
+
+import (
+	"fmt"
+	"net"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/portforward"
+)
+
+// ServiceInfo is a reference to a kubernetes service that a port-forward
+// is, or will be, established against.
+type ServiceInfo struct {
+	Name      string
+	Namespace string
+	Port      string
+}
+
+// Key returns a unique identifier for this service, suitable for use as
+// a map key.
+func (s *ServiceInfo) Key() string {
+	return fmt.Sprintf("%s/%s", s.Name, s.Namespace)
+}
+
+// PodInfo is a reference to a kubernetes pod that is backing a
+// port-forward.
+type PodInfo struct {
+	Name      string
+	Namespace string
+}
+
+// Key returns a unique identifier for this pod, suitable for use as a
+// map key.
+func (p *PodInfo) Key() string {
+	return fmt.Sprintf("%s/%s", p.Name, p.Namespace)
+}
+
+// podEvent is what the pod informer publishes to podReaperChan. Deleted
+// distinguishes a removal from an update, since a deleted pod's last-known
+// object frequently still reports a stale Ready condition.
+type podEvent struct {
+	Pod     *corev1.Pod
+	Deleted bool
+}
+
+// TargetKind is the kind of resource a TargetRef points at.
+type TargetKind string
+
+const (
+	// TargetKindService resolves to a ready pod behind a service's
+	// endpoints, as localizer has always done.
+	TargetKindService TargetKind = "Service"
+
+	// TargetKindPod forwards directly to a named pod, skipping the
+	// endpoints lookup entirely.
+	TargetKindPod TargetKind = "Pod"
+
+	// TargetKindDeployment resolves to a ready pod owned by a deployment,
+	// via the deployment's label selector.
+	TargetKindDeployment TargetKind = "Deployment"
+
+	// TargetKindStatefulSet resolves to a ready pod owned by a
+	// statefulset, via the statefulset's label selector.
+	TargetKindStatefulSet TargetKind = "StatefulSet"
+
+	// TargetKindDaemonSet resolves to a ready pod owned by a daemonset,
+	// via the daemonset's label selector.
+	TargetKindDaemonSet TargetKind = "DaemonSet"
+
+	// TargetKindURL forwards to an arbitrary host:port through a local
+	// TCP proxy, instead of an SPDY port-forward.
+	TargetKindURL TargetKind = "URL"
+)
+
+// TargetRef is a generalized reference to something localizer can
+// forward traffic to: a service, a workload (by label selector), a
+// specific pod, or an arbitrary external host:port.
+type TargetRef struct {
+	Kind      TargetKind
+	Name      string
+	Namespace string
+
+	// HostPort is the "host:port" address to dial, only used when
+	// Kind is TargetKindURL.
+	HostPort string
+}
+
+// Key returns a unique identifier for this target, suitable for use as
+// a map key.
+func (t *TargetRef) Key() string {
+	if t.Kind == TargetKindURL {
+		return fmt.Sprintf("%s/%s", t.Kind, t.HostPort)
+	}
+
+	return fmt.Sprintf("%s/%s/%s", t.Kind, t.Name, t.Namespace)
+}
+
+// ServiceInfo returns the ServiceInfo equivalent of this target, valid
+// only when Kind is TargetKindService.
+func (t *TargetRef) ServiceInfo() ServiceInfo {
+	return ServiceInfo{Name: t.Name, Namespace: t.Namespace}
+}
+
+// PortForwardStatus is the current status of a port-forward connection.
+type PortForwardStatus string
+
+const (
+	// PortForwardStatusRunning denotes that the port-forward is actively
+	// forwarding traffic to a pod.
+	PortForwardStatusRunning PortForwardStatus = "running"
+
+	// PortForwardStatusWaiting denotes that the port-forward is waiting
+	// for an endpoint to become available.
+	PortForwardStatusWaiting PortForwardStatus = "waiting"
+
+	// PortForwardStatusRecreating denotes that the port-forward is in the
+	// process of being torn down and re-established.
+	PortForwardStatusRecreating PortForwardStatus = "recreating"
+
+	// PortForwardStatusFailed denotes that the port-forward could not be
+	// (re-)established and has given up retrying.
+	PortForwardStatusFailed PortForwardStatus = "failed"
+)
+
+// PortForwardRequest is a request sent to the worker's request channel.
+// Exactly one of the embedded requests should be set.
+type PortForwardRequest struct {
+	CreatePortForwardRequest *CreatePortForwardRequest
+	DeletePortForwardRequest *DeletePortForwardRequest
+}
+
+// CreatePortForwardRequest requests that a port-forward be created for
+// a given service.
+type CreatePortForwardRequest struct {
+	Service   ServiceInfo
+	Hostnames []string
+	Ports     []int
+
+	// Target generalizes Service to any forwardable resource. When its
+	// Kind is unset, it is treated as TargetKindService using Service
+	// above, for backwards compatibility.
+	Target TargetRef
+
+	// Endpoint, when set, skips pod resolution and forwards directly to
+	// this pod.
+	Endpoint *PodInfo
+
+	// LoadBalance, when set for a Service target, forwards to every
+	// ready endpoint behind the service instead of just one, round-
+	// robining local connections across them.
+	LoadBalance bool
+
+	// PreferredIP, when set, is acquired instead of a fresh IP from the
+	// pool. Used by --takeover to re-establish a tunnel on the same IP a
+	// previous worker had allocated, so long-lived client connections
+	// don't need to notice the handoff.
+	PreferredIP net.IP
+
+	// Recreate denotes that this is a recreation of an existing
+	// port-forward, e.g. in response to the pod disappearing.
+	Recreate bool
+
+	// RecreateReason is a human readable explanation of why this
+	// port-forward is being recreated. Only set when Recreate is true.
+	RecreateReason string
+
+	// RetryPolicy controls how recreation attempts are paced and capped.
+	// When nil, DefaultRetryPolicy() is used.
+	RetryPolicy *RetryPolicy
+
+	// OnError, when set, is called whenever this port-forward fails,
+	// including failures that will be retried. It can be used to surface
+	// failures to a status subsystem or UI.
+	OnError func(ServiceInfo, error)
+
+	// OnRecreate, when set, is called before a recreate is attempted. If
+	// it returns false, the recreate is vetoed and the port-forward is
+	// left torn down.
+	OnRecreate func(ServiceInfo, string) bool
+}
+
+// DeletePortForwardRequest requests that a port-forward be torn down for
+// a given service.
+type DeletePortForwardRequest struct {
+	Service ServiceInfo
+}
+
+// PortForwardConnection tracks the state of an established (or
+// attempted) port-forward.
+type PortForwardConnection struct {
+	Service      ServiceInfo
+	Target       TargetRef
+	Pod          PodInfo
+	Status       PortForwardStatus
+	StatusReason string
+
+	IP        net.IP
+	Hostnames []string
+	Ports     []int
+
+	// Attempts is the number of times this port-forward has been
+	// (re)created, including the initial creation.
+	Attempts int
+
+	// RetryPolicy is the backoff policy used when this port-forward needs
+	// to be recreated.
+	RetryPolicy *RetryPolicy
+
+	// OnError and OnRecreate are carried over from the request that
+	// created this connection, so that recreates triggered by the Reaper
+	// still invoke the consumer's hooks. Not serializable, so excluded
+	// from the API's JSON representation.
+	OnError    func(ServiceInfo, error)       `json:"-"`
+	OnRecreate func(ServiceInfo, string) bool `json:"-"`
+
+	// LoadBalance mirrors the request field, so recreates/updates know to
+	// keep treating this connection as a pool.
+	LoadBalance bool
+
+	pf           *portforward.PortForwarder
+	urlListeners []net.Listener
+	pool         *endpointPool
+}
@@ -0,0 +1,90 @@
+// Copyright 2020 Jared Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package proxier
+
+import (
+	"context"
+	"io"
+	"net"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// startURLProxy listens on ip for each of ports and proxies accepted
+// connections to remoteAddr ("host:port") over a plain TCP dial. This is
+// used for TargetKindURL, where there's no pod to SPDY port-forward to.
+func (w *worker) startURLProxy(ctx context.Context, ip net.IP, ports []int, remoteAddr string) ([]net.Listener, error) {
+	listeners := make([]net.Listener, 0, len(ports))
+	for _, port := range ports {
+		ln, err := net.Listen("tcp", net.JoinHostPort(ip.String(), strconv.Itoa(port)))
+		if err != nil {
+			return listeners, errors.Wrap(err, "failed to listen for url proxy")
+		}
+
+		listeners = append(listeners, ln)
+		go w.acceptURLProxyConns(ctx, ln, remoteAddr)
+	}
+
+	return listeners, nil
+}
+
+// acceptURLProxyConns accepts connections on ln until ctx is canceled or
+// the listener is closed, proxying each to remoteAddr.
+func (w *worker) acceptURLProxyConns(ctx context.Context, ln net.Listener, remoteAddr string) {
+	go func() {
+		<-ctx.Done()
+		ln.Close() //nolint:errcheck // best effort, we're shutting down
+	}()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			select {
+			case <-ctx.Done():
+				return
+			default:
+				w.log.WithError(err).Warn("url proxy listener closed")
+				return
+			}
+		}
+
+		go proxyURLConn(conn, remoteAddr, w.log)
+	}
+}
+
+// proxyURLConn dials remoteAddr and pipes bytes between it and conn until
+// either side closes.
+func proxyURLConn(conn net.Conn, remoteAddr string, log logrus.FieldLogger) {
+	defer conn.Close() //nolint:errcheck // best effort
+
+	remote, err := net.Dial("tcp", remoteAddr)
+	if err != nil {
+		log.WithError(err).Warn("failed to dial url proxy target")
+		return
+	}
+	defer remote.Close() //nolint:errcheck // best effort
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(remote, conn) //nolint:errcheck // connection teardown, nothing to do with the error
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(conn, remote) //nolint:errcheck // connection teardown, nothing to do with the error
+		done <- struct{}{}
+	}()
+	<-done
+}